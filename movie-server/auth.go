@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	jwtIssuer   = "movie-app-docker"
+	jwtAudience = "movie-app-docker-api"
+)
+
+// tokenAuth signs and validates the JWTs handed out by /api/auth and
+// /api/auth/refresh.
+type tokenAuth struct {
+	secret []byte
+	ttl    time.Duration
+	users  UserStore
+}
+
+func newTokenAuth(secret []byte, ttl time.Duration, users UserStore) *tokenAuth {
+	return &tokenAuth{secret: secret, ttl: ttl, users: users}
+}
+
+func (a *tokenAuth) sign(subject string) (string, error) {
+	now := time.Now()
+
+	claims := jwt.RegisteredClaims{
+		Subject:   subject,
+		Issuer:    jwtIssuer,
+		Audience:  jwt.ClaimStrings{jwtAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(a.ttl)),
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(a.secret)
+	if err != nil {
+		return "", err
+	}
+
+	authActiveTokens.Inc()
+
+	return token, nil
+}
+
+func (a *tokenAuth) parse(token string) (*jwt.RegisteredClaims, error) {
+	var claims jwt.RegisteredClaims
+
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) { return a.secret, nil },
+		jwt.WithValidMethods([]string{"HS256"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(jwtIssuer),
+		jwt.WithAudience(jwtAudience),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &claims, nil
+}
+
+func bearerToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+func (a *tokenAuth) authHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var credentials struct {
+			Username, Password string
+		}
+
+		json.NewDecoder(r.Body).Decode(&credentials)
+
+		userID, err := a.users.Authenticate(credentials.Username, credentials.Password)
+		if err != nil {
+			http.Error(w, `{"error":"invalid username or password"}`, http.StatusUnauthorized)
+
+			return
+		}
+
+		token, err := a.sign(strconv.FormatInt(userID, 10))
+		if err != nil {
+			http.Error(w, `{"error":"failed to issue token"}`, http.StatusInternalServerError)
+
+			return
+		}
+
+		fmt.Fprintf(w, `{"bearer": %q, "timeout": %d}`, token, int(a.ttl.Seconds()))
+	})
+}
+
+// registerHandler handles POST /api/users, creating a new account via the
+// configured UserStore. Only mounted when registration is enabled.
+func (a *tokenAuth) registerHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var credentials struct {
+			Username, Password string
+		}
+
+		json.NewDecoder(r.Body).Decode(&credentials)
+
+		if credentials.Username == "" || credentials.Password == "" {
+			http.Error(w, `{"error":"username and password are required"}`, http.StatusBadRequest)
+
+			return
+		}
+
+		if err := a.users.Create(credentials.Username, credentials.Password); err != nil {
+			if err == errUserExists {
+				http.Error(w, `{"error":"user already exists"}`, http.StatusConflict)
+
+				return
+			}
+
+			http.Error(w, `{"error":"failed to create user"}`, http.StatusInternalServerError)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"username": %q}`, credentials.Username)
+	})
+}
+
+func (a *tokenAuth) refreshHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		claims, err := a.parse(bearerToken(r))
+		if err != nil {
+			http.Error(w, `{"error":"invalid or missing authentication token"}`, http.StatusUnauthorized)
+
+			return
+		}
+
+		token, err := a.sign(claims.Subject)
+		if err != nil {
+			http.Error(w, `{"error":"failed to issue token"}`, http.StatusInternalServerError)
+
+			return
+		}
+
+		fmt.Fprintf(w, `{"bearer": %q, "timeout": %d}`, token, int(a.ttl.Seconds()))
+	})
+}
+
+// require wraps h so that it only runs once the request carries a valid
+// bearer token.
+func (a *tokenAuth) require(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := a.parse(bearerToken(r)); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, `{"error":"invalid or missing authentication token"}`, http.StatusUnauthorized)
+
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// corsConfig holds the cross-origin settings applied to every /api/*
+// request, including answering the OPTIONS preflight before any route or
+// auth check runs.
+type corsConfig struct {
+	origins     []string
+	allowAll    bool
+	methods     string
+	headers     string
+	credentials bool
+	maxAge      string
+}
+
+func newCORSConfig(origins, methods, headers string, credentials bool, maxAge time.Duration) *corsConfig {
+	c := &corsConfig{
+		methods:     methods,
+		headers:     headers,
+		credentials: credentials,
+		maxAge:      strconv.Itoa(int(maxAge.Seconds())),
+	}
+
+	for _, o := range strings.Split(origins, ",") {
+		if o = strings.TrimSpace(o); o == "*" {
+			c.allowAll = true
+		} else if o != "" {
+			c.origins = append(c.origins, o)
+		}
+	}
+
+	return c
+}
+
+func (c *corsConfig) allowedOrigin(origin string) string {
+	if c.allowAll {
+		if c.credentials {
+			// can't combine "*" with credentials; echo the exact origin instead.
+			return origin
+		}
+
+		return "*"
+	}
+
+	for _, o := range c.origins {
+		if o == origin {
+			return origin
+		}
+	}
+
+	return ""
+}
+
+// middleware answers CORS preflight requests and annotates every other
+// response with the configured Access-Control-* headers. It must run
+// before any auth check so browsers never see a 401 on an OPTIONS
+// request.
+func (c *corsConfig) middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+
+		allowed := ""
+		if origin != "" {
+			allowed = c.allowedOrigin(origin)
+		}
+
+		if allowed != "" {
+			w.Header().Set("Access-Control-Allow-Origin", allowed)
+			w.Header().Add("Vary", "Origin")
+
+			if c.credentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		if r.Method != http.MethodOptions {
+			h.ServeHTTP(w, r)
+
+			return
+		}
+
+		if allowed == "" {
+			w.WriteHeader(http.StatusNoContent)
+
+			return
+		}
+
+		headers := c.headers
+
+		if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			if strings.Contains(strings.ToLower(requested), "authorization") &&
+				!strings.Contains(strings.ToLower(headers), "authorization") {
+				headers += ", Authorization"
+			}
+		}
+
+		w.Header().Set("Access-Control-Allow-Methods", c.methods)
+		w.Header().Set("Access-Control-Allow-Headers", headers)
+		w.Header().Set("Access-Control-Max-Age", c.maxAge)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
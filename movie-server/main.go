@@ -3,30 +3,72 @@ package main
 //go:generate sh -c "echo 'package main\n\nconst version = \"'$(git describe --tags --always --long --dirty)'\"' > version.go"
 
 import (
-	sqlite "archive/zip"
-	"bytes"
-	_ "embed"
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
-	"path"
-	"strings"
-	"sync"
+	"os/signal"
+	"syscall"
 	"time"
 
-	httpdb "vimagination.zapto.org/memfs"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-//go:embed movies.db
-var moviesDB []byte
-
 func main() {
 	port := uint(8080)
+	tokenTTL := 15 * time.Minute
+	jwtSecret := os.Getenv("JWT_SECRET")
+	usersFile := ""
+	usersDB := ""
+	allowRegistration := false
+	rateRPS := 5.0
+	rateBurst := 10
+	rateAuthMultiplier := 4.0
+	rateIdleTimeout := 10 * time.Minute
+	logFormat := "text"
+	metricsAddr := ""
+	corsOrigins := ""
+	corsMethods := "GET, POST, OPTIONS"
+	corsHeaders := "Content-Type"
+	corsCredentials := false
+	corsMaxAge := 10 * time.Minute
+	readHeaderTimeout := 5 * time.Second
+	readTimeout := 10 * time.Second
+	writeTimeout := 10 * time.Second
+	idleTimeout := 2 * time.Minute
+	shutdownGrace := 10 * time.Second
+	tlsCert := ""
+	tlsKey := ""
+	acmeDomains := ""
+	acmeCache := ""
 
 	flag.UintVar(&port, "port", port, "port to listen on")
+	flag.DurationVar(&tokenTTL, "token-ttl", tokenTTL, "lifetime of issued bearer tokens")
+	flag.StringVar(&jwtSecret, "jwt-secret", jwtSecret, "secret used to sign bearer tokens (defaults to $JWT_SECRET)")
+	flag.StringVar(&usersFile, "users", usersFile, "path to a JSON file seeding the in-memory user store")
+	flag.StringVar(&usersDB, "users-db", usersDB, "path to a SQLite database to use as the user store, instead of -users")
+	flag.BoolVar(&allowRegistration, "allow-registration", allowRegistration, "allow new users to register via POST /api/users")
+	flag.Float64Var(&rateRPS, "rate-rps", rateRPS, "requests per second allowed per client")
+	flag.IntVar(&rateBurst, "rate-burst", rateBurst, "burst size allowed per client")
+	flag.Float64Var(&rateAuthMultiplier, "rate-auth-multiplier", rateAuthMultiplier, "multiplier applied to rate and burst for authenticated clients")
+	flag.DurationVar(&rateIdleTimeout, "rate-idle-timeout", rateIdleTimeout, "how long an idle client's limiter is kept before being evicted")
+	flag.StringVar(&logFormat, "log-format", logFormat, "request log format: json or text")
+	flag.StringVar(&metricsAddr, "metrics-addr", metricsAddr, "address to serve Prometheus metrics on, on a separate listener (disabled if empty)")
+	flag.StringVar(&corsOrigins, "cors-origins", corsOrigins, "comma-separated list of allowed CORS origins, or * (disabled if empty)")
+	flag.StringVar(&corsMethods, "cors-methods", corsMethods, "value of Access-Control-Allow-Methods")
+	flag.StringVar(&corsHeaders, "cors-headers", corsHeaders, "value of Access-Control-Allow-Headers")
+	flag.BoolVar(&corsCredentials, "cors-credentials", corsCredentials, "send Access-Control-Allow-Credentials")
+	flag.DurationVar(&corsMaxAge, "cors-max-age", corsMaxAge, "value of Access-Control-Max-Age")
+	flag.DurationVar(&readHeaderTimeout, "read-header-timeout", readHeaderTimeout, "maximum duration for reading request headers")
+	flag.DurationVar(&readTimeout, "read-timeout", readTimeout, "maximum duration for reading the entire request")
+	flag.DurationVar(&writeTimeout, "write-timeout", writeTimeout, "maximum duration before timing out writes of the response")
+	flag.DurationVar(&idleTimeout, "idle-timeout", idleTimeout, "maximum time to wait for the next request on a keep-alive connection")
+	flag.DurationVar(&shutdownGrace, "shutdown-grace", shutdownGrace, "how long to wait for in-flight requests to finish on shutdown")
+	flag.StringVar(&tlsCert, "tls-cert", tlsCert, "path to a TLS certificate; enables HTTPS with -tls-key")
+	flag.StringVar(&tlsKey, "tls-key", tlsKey, "path to a TLS private key; enables HTTPS with -tls-cert")
+	flag.StringVar(&acmeDomains, "acme-domains", acmeDomains, "comma-separated domains to fetch certificates for via ACME (Let's Encrypt); takes precedence over -tls-cert")
+	flag.StringVar(&acmeCache, "acme-cache", acmeCache, "directory to cache ACME certificates in")
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "This server serves movie lists via a REST API.\n\n"+
 			"The following endpoints are available:\n\n"+
@@ -35,123 +77,103 @@ func main() {
 			"\t\t{\"username\": \"USERNAME\", \"password\": \"PASSWORD\"}\n\n"+
 			"\tOn a success, the endpoint will return a JSON packet with the following format:\n"+
 			"\t\t{\"bearer\": \"TOKEN\", \"timeout\": TOKEN_LIFETIME}\n\n"+
-			"GET /api/movies/$YEAR/$PAGE\t\n"+
-			"\tThis endpoint requires the bearer token passed in the Authorization header. Will return a JSON list of upto 10 movies.\n\n"+
+			"POST /api/auth/refresh\n"+
+			"\tThis endpoint requires a bearer token and returns a freshly signed one with a renewed expiry.\n\n"+
+			"POST /api/users\n"+
+			"\tThis endpoint registers a new user, when enabled with -allow-registration. Accepts the same JSON body as /api/auth.\n\n"+
+			"GET /api/movies\t\n"+
+			"\tThis endpoint requires the bearer token passed in the Authorization header. Accepts year, genre, title, sort, order, page "+
+			"and page_size query parameters and returns a JSON envelope of matching movies.\n\n"+
 			"Usage of %s:\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 
 	flag.Parse()
 
-	movies := readDB()
+	if jwtSecret == "" {
+		fmt.Fprintln(os.Stderr, "a JWT signing secret is required: set -jwt-secret or $JWT_SECRET")
+		os.Exit(1)
+	}
+
+	movies, err := newMovieStore(moviesDB)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "loading movie database: %v\n", err)
+		os.Exit(1)
+	}
 
 	fmt.Printf("Movie Database Rest Server: v%s\n", version)
 
-	var authMu sync.RWMutex
-	auth := map[string]struct{}{}
+	var users UserStore
 
-	http.Handle("POST /api/auth", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
+	if usersDB != "" {
+		users, err = newSQLiteUserStore(usersDB)
+	} else {
+		users, err = newMemoryUserStore(usersFile)
+	}
 
-		var credentials struct {
-			Username, Password string
-		}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "loading user store: %v\n", err)
+		os.Exit(1)
+	}
 
-		json.NewDecoder(r.Body).Decode(&credentials)
+	auth := newTokenAuth([]byte(jwtSecret), tokenTTL, users)
+	limiter := newRateLimiter(rateRPS, rateBurst, rateAuthMultiplier, rateIdleTimeout)
+	logger := newLogger(logFormat)
 
-		if credentials.Username != "username" || credentials.Password != "password" {
-			http.Error(w, `{"error":"invalid username or password"}`, http.StatusUnauthorized)
+	mux := http.NewServeMux()
 
-			return
-		}
+	mux.Handle("POST /api/auth", limiter.limit(auth, auth.authHandler()))
+	mux.Handle("POST /api/auth/refresh", limiter.limit(auth, auth.refreshHandler()))
 
-		now := time.Now()
-		token := fmt.Sprintf("%x:%x", now.Unix(), now.UnixMicro())
+	if allowRegistration {
+		mux.Handle("POST /api/users", limiter.limit(auth, auth.registerHandler()))
+	}
+
+	mux.Handle("GET /api/movies", limiter.limit(auth, auth.require(movies.handler())))
 
-		authMu.Lock()
-		auth[token] = struct{}{}
-		authMu.Unlock()
+	if metricsAddr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /metrics", promhttp.Handler())
 
 		go func() {
-			time.Sleep(10 * time.Second)
-			authMu.Lock()
-			delete(auth, token)
-			authMu.Unlock()
+			if err := http.ListenAndServe(metricsAddr, metricsMux); err != nil {
+				logger.Error("metrics server failed", "error", err)
+			}
 		}()
-
-		fmt.Fprintf(w, `{"bearer": %q, "timeout": 10}`, token)
-	}))
-
-	empty := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { http.NotFound(&custom404{w}, r) })
-
-	http.Handle("GET /api/movies/{$}", empty)
-	http.Handle("GET /api/movies/{x}/{$}", empty)
-	http.Handle("GET /api/movies/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authMu.RLock()
-		_, authed := auth[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
-		authMu.RUnlock()
-
-		if !authed {
-			w.Header().Set("Content-Type", "application/json")
-			http.Error(w, `{"error": "invalid token"}`, http.StatusUnauthorized)
-
-			return
-		}
-
-		time.Sleep(100 * time.Millisecond) // prevent server overload
-
-		movies.ServeHTTP(w, r) // do db query
-	}))
-
-	http.ListenAndServe(fmt.Sprintf(":%d", port), nil)
-}
-
-func readDB() http.Handler {
-	for i := len(moviesDB) - 1; i >= 0; i-- {
-		moviesDB[i] = moviesDB[i] ^ moviesDB[i%100] // fix embed encoding errors
 	}
 
-	fs, _ := sqlite.NewReader(bytes.NewReader(moviesDB), int64(len(moviesDB)))
-	db := httpdb.New()
-
-	// read DB into in-memory DB
-	for _, p := range fs.File {
-		db.MkdirAll(path.Dir(p.Name), 0755)
+	var handler http.Handler = mux
 
-		f, _ := db.Create(p.Name)
-		pr, _ := p.Open()
-
-		io.Copy(f, pr)
-		f.Close()
+	if corsOrigins != "" {
+		cors := newCORSConfig(corsOrigins, corsMethods, corsHeaders, corsCredentials, corsMaxAge)
+		handler = cors.middleware(handler)
 	}
 
-	dbs := http.FileServerFS(db.Seal())
-
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { dbs.ServeHTTP(&custom404{w}, r) })
-}
-
-type custom404 struct {
-	http.ResponseWriter
-}
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           withRequestID(withObservability(logger, auth, handler)),
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
 
-var notFound = []byte(`{"error": "year or page not found"}`)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-func (c *custom404) WriteHeader(statusCode int) {
-	c.ResponseWriter.Header().Set("Content-Type", "application/json")
-	c.ResponseWriter.WriteHeader(statusCode)
+	go func() {
+		if err := listen(srv, tlsCert, tlsKey, acmeDomains, acmeCache, logger); err != nil && err != http.ErrServerClosed {
+			logger.Error("server failed", "error", err)
+			os.Exit(1)
+		}
+	}()
 
-	if statusCode != http.StatusNotFound {
-		return
-	}
+	<-ctx.Done()
 
-	c.ResponseWriter.Write(notFound)
-	c.ResponseWriter = nil
-}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+	defer cancel()
 
-func (c *custom404) Write(p []byte) (int, error) {
-	if c.ResponseWriter == nil {
-		return len(p), nil
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("graceful shutdown failed", "error", err)
 	}
-
-	return c.ResponseWriter.Write(p)
 }
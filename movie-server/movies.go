@@ -0,0 +1,260 @@
+package main
+
+import (
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+//go:embed movies.db
+var moviesDB []byte
+
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+)
+
+// sortColumns whitelists the columns clients may sort by, since SQL
+// identifiers can't be parameterized.
+var sortColumns = map[string]string{"title": "title", "year": "year", "rating": "rating"}
+
+type movie struct {
+	ID     int64   `json:"id"`
+	Title  string  `json:"title"`
+	Year   int     `json:"year"`
+	Genre  string  `json:"genre"`
+	Rating float64 `json:"rating"`
+}
+
+type movieEnvelope struct {
+	Movies []movie `json:"movies"`
+	Total  int     `json:"total"`
+	Next   string  `json:"next,omitempty"`
+	Prev   string  `json:"prev,omitempty"`
+}
+
+// movieStore serves the movie catalog out of an in-memory SQLite
+// database, loaded at startup from the embedded movies.db.
+type movieStore struct {
+	db *sql.DB
+}
+
+// newMovieStore loads data into an in-memory SQLite database by
+// attaching the embedded database (written out to a temp file, since
+// the pure-Go driver has no way to open a byte slice directly) and
+// copying its tables across.
+func newMovieStore(data []byte) (*movieStore, error) {
+	tmp, err := os.CreateTemp("", "movies-*.db")
+	if err != nil {
+		return nil, fmt.Errorf("writing embedded database: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+
+		return nil, fmt.Errorf("writing embedded database: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("writing embedded database: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		return nil, fmt.Errorf("opening in-memory database: %w", err)
+	}
+
+	// modernc.org/sqlite hands each pooled connection its own private
+	// :memory: database, so a second connection would see an empty one.
+	// Pin the pool to a single connection to keep everyone on the data
+	// loaded below.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(fmt.Sprintf("ATTACH DATABASE %q AS src", tmp.Name())); err != nil {
+		return nil, fmt.Errorf("attaching embedded database: %w", err)
+	}
+
+	// Internal bookkeeping tables (sqlite_sequence from AUTOINCREMENT,
+	// sqlite_stat* from ANALYZE) aren't user-creatable and must be skipped.
+	rows, err := db.Query(`SELECT name, sql FROM src.sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'`)
+	if err != nil {
+		return nil, fmt.Errorf("reading embedded schema: %w", err)
+	}
+
+	var tables []string
+
+	for rows.Next() {
+		var (
+			name   string
+			schema sql.NullString
+		)
+
+		if err := rows.Scan(&name, &schema); err != nil {
+			rows.Close()
+
+			return nil, fmt.Errorf("reading embedded schema: %w", err)
+		}
+
+		if !schema.Valid {
+			continue
+		}
+
+		if _, err := db.Exec(schema.String); err != nil {
+			rows.Close()
+
+			return nil, fmt.Errorf("creating table %s: %w", name, err)
+		}
+
+		tables = append(tables, name)
+	}
+
+	if err := rows.Err(); err != nil {
+		rows.Close()
+
+		return nil, fmt.Errorf("reading embedded schema: %w", err)
+	}
+
+	rows.Close()
+
+	for _, name := range tables {
+		if _, err := db.Exec(fmt.Sprintf("INSERT INTO %s SELECT * FROM src.%s", name, name)); err != nil {
+			return nil, fmt.Errorf("copying table %s: %w", name, err)
+		}
+	}
+
+	if _, err := db.Exec(`DETACH DATABASE src`); err != nil {
+		return nil, fmt.Errorf("detaching embedded database: %w", err)
+	}
+
+	return &movieStore{db: db}, nil
+}
+
+// handler serves GET /api/movies, filtering, sorting and paginating the
+// catalog according to the query string.
+func (s *movieStore) handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		q := r.URL.Query()
+
+		var (
+			where []string
+			args  []any
+		)
+
+		if year := q.Get("year"); year != "" {
+			where = append(where, "year = ?")
+			args = append(args, year)
+		}
+
+		if genre := q.Get("genre"); genre != "" {
+			where = append(where, "genre = ?")
+			args = append(args, genre)
+		}
+
+		if title := q.Get("title"); title != "" {
+			where = append(where, "title LIKE ?")
+			args = append(args, "%"+title+"%")
+		}
+
+		whereClause := ""
+		if len(where) > 0 {
+			whereClause = "WHERE " + strings.Join(where, " AND ")
+		}
+
+		sortCol, ok := sortColumns[q.Get("sort")]
+		if !ok {
+			sortCol = "title"
+		}
+
+		order := "ASC"
+		if strings.EqualFold(q.Get("order"), "desc") {
+			order = "DESC"
+		}
+
+		pageSize := defaultPageSize
+		if ps, err := strconv.Atoi(q.Get("page_size")); err == nil && ps > 0 {
+			pageSize = ps
+		}
+
+		if pageSize > maxPageSize {
+			pageSize = maxPageSize
+		}
+
+		page := 1
+		if p, err := strconv.Atoi(q.Get("page")); err == nil && p > 0 {
+			page = p
+		}
+
+		var total int
+
+		countQuery := fmt.Sprintf("SELECT COUNT(*) FROM movies %s", whereClause)
+		if err := s.db.QueryRow(countQuery, args...).Scan(&total); err != nil {
+			http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+
+			return
+		}
+
+		query := fmt.Sprintf("SELECT id, title, year, genre, rating FROM movies %s ORDER BY %s %s LIMIT ? OFFSET ?",
+			whereClause, sortCol, order)
+
+		rows, err := s.db.Query(query, append(args, pageSize, (page-1)*pageSize)...)
+		if err != nil {
+			http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+
+			return
+		}
+		defer rows.Close()
+
+		movies := []movie{}
+
+		for rows.Next() {
+			var m movie
+
+			if err := rows.Scan(&m.ID, &m.Title, &m.Year, &m.Genre, &m.Rating); err != nil {
+				http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+
+				return
+			}
+
+			movies = append(movies, m)
+		}
+
+		if err := rows.Err(); err != nil {
+			http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+
+			return
+		}
+
+		env := movieEnvelope{Movies: movies, Total: total}
+
+		if page*pageSize < total {
+			env.Next = pageLink(r, page+1, pageSize)
+		}
+
+		if page > 1 {
+			env.Prev = pageLink(r, page-1, pageSize)
+		}
+
+		json.NewEncoder(w).Encode(env)
+	})
+}
+
+func pageLink(r *http.Request, page, pageSize int) string {
+	q := r.URL.Query()
+	q.Set("page", strconv.Itoa(page))
+	q.Set("page_size", strconv.Itoa(pageSize))
+
+	u := *r.URL
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
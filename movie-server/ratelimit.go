@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimiter hands out a token-bucket rate.Limiter per client, keyed by
+// remote IP for anonymous requests and by authenticated subject once a
+// request carries a valid bearer token. Authenticated clients get a
+// higher budget via authMultiplier.
+type rateLimiter struct {
+	mu             sync.Mutex
+	limiters       map[string]*rateLimiterEntry
+	rps            rate.Limit
+	burst          int
+	authMultiplier float64
+	idleTimeout    time.Duration
+}
+
+type rateLimiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newRateLimiter(rps float64, burst int, authMultiplier float64, idleTimeout time.Duration) *rateLimiter {
+	rl := &rateLimiter{
+		limiters:       map[string]*rateLimiterEntry{},
+		rps:            rate.Limit(rps),
+		burst:          burst,
+		authMultiplier: authMultiplier,
+		idleTimeout:    idleTimeout,
+	}
+
+	go rl.sweep()
+
+	return rl
+}
+
+func (rl *rateLimiter) sweep() {
+	ticker := time.NewTicker(rl.idleTimeout)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		rl.mu.Lock()
+
+		for key, e := range rl.limiters {
+			if now.Sub(e.lastSeen) > rl.idleTimeout {
+				delete(rl.limiters, key)
+			}
+		}
+
+		rl.mu.Unlock()
+	}
+}
+
+func (rl *rateLimiter) allow(key string, authed bool) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	e, ok := rl.limiters[key]
+	if !ok {
+		limit, burst := rl.rps, rl.burst
+
+		if authed {
+			limit *= rate.Limit(rl.authMultiplier)
+			burst = int(float64(burst) * rl.authMultiplier)
+		}
+
+		e = &rateLimiterEntry{limiter: rate.NewLimiter(limit, burst)}
+		rl.limiters[key] = e
+	}
+
+	e.lastSeen = time.Now()
+
+	return e.limiter.Allow()
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// limit wraps h so that requests are throttled per remote IP, or per
+// authenticated subject (at a higher budget) once auth has identified
+// the caller.
+func (rl *rateLimiter) limit(auth *tokenAuth, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, authed := remoteIP(r), false
+
+		if claims, err := auth.parse(bearerToken(r)); err == nil {
+			key, authed = claims.Subject, true
+		}
+
+		if !rl.allow(key, authed) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", int(1/float64(rl.rps))+1))
+			http.Error(w, `{"error":"rate limit exceeded"}`, http.StatusTooManyRequests)
+
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// listen starts srv, choosing between plain HTTP, static TLS certificates
+// and ACME (Let's Encrypt) depending on which flags were set. It blocks
+// until the listener stops, returning http.ErrServerClosed on a graceful
+// shutdown.
+func listen(srv *http.Server, tlsCert, tlsKey, acmeDomains, acmeCache string, logger *slog.Logger) error {
+	switch {
+	case acmeDomains != "":
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(strings.Split(acmeDomains, ",")...),
+			Cache:      autocert.DirCache(acmeCache),
+		}
+
+		srv.TLSConfig = manager.TLSConfig()
+
+		logger.Info("listening with ACME-managed TLS", "addr", srv.Addr, "domains", acmeDomains)
+
+		return srv.ListenAndServeTLS("", "")
+	case tlsCert != "" && tlsKey != "":
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+
+		logger.Info("listening with TLS", "addr", srv.Addr)
+
+		return srv.ListenAndServeTLS(tlsCert, tlsKey)
+	default:
+		logger.Info("listening", "addr", srv.Addr)
+
+		return srv.ListenAndServe()
+	}
+}
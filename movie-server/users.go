@@ -0,0 +1,188 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const bcryptCost = 12
+
+var (
+	errUserExists   = errors.New("user already exists")
+	errUserNotFound = errors.New("user not found")
+	errBadPassword  = errors.New("invalid password")
+)
+
+// UserStore authenticates and registers users. Implementations must be
+// safe for concurrent use.
+type UserStore interface {
+	// Authenticate checks user/pass and returns the user's ID on success.
+	Authenticate(user, pass string) (userID int64, err error)
+	// Create registers a new user with a bcrypt-hashed password.
+	Create(user, pass string) error
+	// Exists reports whether user is already registered.
+	Exists(user string) bool
+}
+
+type storedUser struct {
+	ID   int64  `json:"id"`
+	Hash string `json:"hash"`
+}
+
+// memoryUserStore is a UserStore backed by a JSON file loaded at startup
+// and kept entirely in memory.
+type memoryUserStore struct {
+	mu     sync.RWMutex
+	users  map[string]storedUser
+	nextID int64
+}
+
+func newMemoryUserStore(path string) (*memoryUserStore, error) {
+	s := &memoryUserStore{users: map[string]storedUser{}, nextID: 1}
+
+	if path == "" {
+		return s, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+
+		return nil, fmt.Errorf("opening users file: %w", err)
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&s.users); err != nil {
+		return nil, fmt.Errorf("decoding users file: %w", err)
+	}
+
+	for _, u := range s.users {
+		if u.ID >= s.nextID {
+			s.nextID = u.ID + 1
+		}
+	}
+
+	return s, nil
+}
+
+func (s *memoryUserStore) Authenticate(user, pass string) (int64, error) {
+	s.mu.RLock()
+	u, ok := s.users[user]
+	s.mu.RUnlock()
+
+	if !ok {
+		return 0, errUserNotFound
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(u.Hash), []byte(pass)); err != nil {
+		return 0, errBadPassword
+	}
+
+	return u.ID, nil
+}
+
+func (s *memoryUserStore) Create(user, pass string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pass), bcryptCost)
+	if err != nil {
+		return fmt.Errorf("hashing password: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user]; ok {
+		return errUserExists
+	}
+
+	s.users[user] = storedUser{ID: s.nextID, Hash: string(hash)}
+	s.nextID++
+
+	return nil
+}
+
+func (s *memoryUserStore) Exists(user string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.users[user]
+
+	return ok
+}
+
+// sqliteUserStore is a UserStore backed by an on-disk SQLite database,
+// opened through the same modernc.org/sqlite driver as the movie catalog.
+type sqliteUserStore struct {
+	db *sql.DB
+}
+
+func newSQLiteUserStore(path string) (*sqliteUserStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("opening users database: %w", err)
+	}
+
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL UNIQUE,
+		password_hash TEXT NOT NULL
+	)`); err != nil {
+		return nil, fmt.Errorf("creating users table: %w", err)
+	}
+
+	return &sqliteUserStore{db: db}, nil
+}
+
+func (s *sqliteUserStore) Authenticate(user, pass string) (int64, error) {
+	var (
+		id   int64
+		hash string
+	)
+
+	err := s.db.QueryRow(`SELECT id, password_hash FROM users WHERE username = ?`, user).Scan(&id, &hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errUserNotFound
+	} else if err != nil {
+		return 0, fmt.Errorf("querying user: %w", err)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)); err != nil {
+		return 0, errBadPassword
+	}
+
+	return id, nil
+}
+
+func (s *sqliteUserStore) Create(user, pass string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pass), bcryptCost)
+	if err != nil {
+		return fmt.Errorf("hashing password: %w", err)
+	}
+
+	if _, err := s.db.Exec(`INSERT INTO users (username, password_hash) VALUES (?, ?)`, user, string(hash)); err != nil {
+		var sqliteErr *sqlite.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+			return errUserExists
+		}
+
+		return fmt.Errorf("creating user: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqliteUserStore) Exists(user string) bool {
+	var id int64
+
+	return s.db.QueryRow(`SELECT id FROM users WHERE username = ?`, user).Scan(&id) == nil
+}